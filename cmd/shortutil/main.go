@@ -0,0 +1,88 @@
+// ----------------------------------------------------
+// Shortutil
+// A short filename utility written by bitquark
+// ----------------------------------------------------
+// Docs and code: https://github.com/bitquark/shortscan
+// ----------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/bitquark/shortscan/pkg/shortutil"
+	"github.com/fatih/color"
+)
+
+// Command-line arguments
+var args struct {
+	Wordlist *struct {
+		Filename  string                 `arg:"positional,required" help:"wordlist to ingest"`
+		KeepCase  bool                   `arg:"--keepcase" help:"keep the original case rather than upper-casing words" default:"false"`
+		Uniq      bool                   `arg:"--uniq" help:"allow only unique words" default:"true"`
+		Variants  bool                   `arg:"--variants" help:"generate checksums for case variants of input words (e.g. ping.aspx, Ping.aspx, PING.ASPX)" default:"true"`
+		Tildes    int                    `arg:"--tildes" help:"emit short names for the Nth tilde-collision variant, 1..N (e.g. --tildes 3 emits the ~1, ~2 and ~3 short names for each word)" default:"1"`
+		Hashed    bool                   `arg:"--hashed" help:"also emit the NTFS hashed short name (e.g. LO4A12~1), used once six or more files in a directory share a base" default:"false"`
+		Algorithm shortutil.ChecksumAlgo `arg:"-a,--algorithm" help:"checksum algorithm (modern/original/win95/nt/fat32)" default:"modern"`
+		Codepage  shortutil.Codepage     `arg:"--codepage" help:"target OEM/ANSI codepage for non-ASCII words (ascii/cp437/cp850/cp852/cp1252/shiftjis/combined)" default:"combined"`
+	} `arg:"subcommand:wordlist" help:"add hashes to a wordlist for use with, for example, shortscan"`
+	Checksum *struct {
+		Filename  string                 `arg:"positional,required" help:"filename to checksum"`
+		Algorithm shortutil.ChecksumAlgo `arg:"-a,--algorithm" help:"checksum algorithm (modern/original/win95/nt/fat32)" default:"modern"`
+		Original  bool                   `arg:"-o" help:"use the original (Windows Server 2003 + Windows XP) algorithm" default:"false"` // eskiyle uyum için bırakıldı
+	} `arg:"subcommand:checksum" help:"generate a one-off checksum for the given filename"`
+}
+
+// Version
+const version = "0.4"
+
+func main() {
+
+	// Parse command-line arguments
+	p := arg.MustParse(&args)
+	if p.Subcommand() == nil {
+		fmt.Println(color.New(color.FgBlue, color.Bold).Sprint("Shortutil v"+version), "·", color.New(color.FgWhite, color.Bold).Sprint("a short filename utility by bitquark"))
+		p.WriteHelp(os.Stderr)
+		os.Exit(1)
+	}
+
+	switch {
+
+	// Process a wordlist
+	case args.Wordlist != nil:
+
+		// Open the wordlist
+		fh, err := os.Open(args.Wordlist.Filename)
+		if err != nil {
+			log.Fatalf("Error: %s\n", err)
+		}
+
+		// Checksum the wordlist and output the result
+		fmt.Println("#SHORTSCAN#")
+		opts := shortutil.Options{
+			KeepCase:  args.Wordlist.KeepCase,
+			Uniq:      args.Wordlist.Uniq,
+			Variants:  args.Wordlist.Variants,
+			Tildes:    args.Wordlist.Tildes,
+			Hashed:    args.Wordlist.Hashed,
+			Algorithm: args.Wordlist.Algorithm,
+			Codepage:  args.Wordlist.Codepage,
+		}
+		for _, w := range shortutil.ChecksumWords(fh, opts) {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", w.Checksum, w.Filename83, w.Extension83, w.Filename, w.Extension)
+		}
+
+	// Generate a one-off checksum
+	case args.Checksum != nil:
+		algo := args.Checksum.Algorithm
+		if args.Checksum.Original {
+			algo = shortutil.AlgoOriginal
+		}
+		c := shortutil.ChecksummerFor(algo)(args.Checksum.Filename)
+		fmt.Println(c)
+	}
+
+}
@@ -0,0 +1,172 @@
+package shortutil
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Transliterator maps a Unicode string down to the characters a particular
+// Windows OEM/ANSI codepage would have produced for it, upper-cased the way
+// that codepage upper-cases (which, for legacy single-byte codepages, is not
+// always the same as Unicode's own case folding: a codepage may be missing
+// the upper-case glyph for an accented letter it can otherwise represent)
+type Transliterator interface {
+	Transliterate(s string) string
+}
+
+// Codepage identifies one of the OEM/ANSI codepages a Transliterator can target
+type Codepage string
+
+const (
+	CodepageASCII    Codepage = "ascii"    // legacy behaviour: strip to bare ASCII, diacritics removed
+	CodepageCP437    Codepage = "cp437"    // original IBM PC OEM codepage (US)
+	CodepageCP850    Codepage = "cp850"    // OEM codepage (Western Europe / Multilingual Latin I)
+	CodepageCP852    Codepage = "cp852"    // OEM codepage (Central Europe)
+	CodepageCP1252   Codepage = "cp1252"   // Windows ANSI codepage (Western Europe)
+	CodepageShiftJIS Codepage = "shiftjis" // Japanese codepage
+	CodepageCombined Codepage = "combined" // all of the above except ascii at once, deduplicated
+)
+
+// asciiTransliterator reproduces shortscan's original behaviour: diacritics
+// are stripped and the result is upper-cased, regardless of locale
+type asciiTransliterator struct{}
+
+func (asciiTransliterator) Transliterate(s string) string {
+	return strings.ToUpper(ToASCII(s))
+}
+
+// codepageTransliterator implements Transliterator for a legacy single-byte
+// OEM/ANSI codepage. repertoire lists every non-ASCII rune the codepage can
+// represent; a rune missing from it falls back to the closest bare ASCII
+// letter, the same way Windows' "best fit" mapping does for unrepresentable
+// characters
+type codepageTransliterator struct {
+	repertoire map[rune]struct{}
+}
+
+func (c codepageTransliterator) Transliterate(s string) string {
+
+	var b strings.Builder
+	for _, r := range s {
+
+		if r <= unicode.MaxASCII {
+			b.WriteRune(unicode.ToUpper(r))
+			continue
+		}
+
+		// The codepage can't represent this character at all, or can
+		// represent it but has no upper-case glyph for it (CP437 famously
+		// has lower-case "â" but no upper-case "Â"): fall back to ASCII
+		if _, ok := c.repertoire[r]; !ok {
+			b.WriteString(strings.ToUpper(ToASCII(string(r))))
+			continue
+		}
+		u := unicode.ToUpper(r)
+		if _, ok := c.repertoire[u]; !ok {
+			b.WriteString(strings.ToUpper(ToASCII(string(r))))
+			continue
+		}
+
+		b.WriteRune(u)
+
+	}
+	return b.String()
+
+}
+
+// shiftJISTransliterator implements Transliterator for Shift-JIS. Japanese
+// kana and kanji have no concept of upper/lower case, so they pass through
+// unchanged; anything else falls back to the closest bare ASCII letter
+type shiftJISTransliterator struct{}
+
+func (shiftJISTransliterator) Transliterate(s string) string {
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r <= unicode.MaxASCII:
+			b.WriteRune(unicode.ToUpper(r))
+		case isKanaOrKanji(r):
+			b.WriteRune(r)
+		default:
+			b.WriteString(strings.ToUpper(ToASCII(string(r))))
+		}
+	}
+	return b.String()
+
+}
+
+// isKanaOrKanji reports whether r falls in the Hiragana, Katakana, CJK
+// Unified Ideographs or half-width Katakana ranges
+func isKanaOrKanji(r rune) bool {
+	switch {
+	case r >= 0x3040 && r <= 0x30FF: // Hiragana, Katakana
+		return true
+	case r >= 0x4E00 && r <= 0x9FFF: // CJK Unified Ideographs
+		return true
+	case r >= 0xFF61 && r <= 0xFF9F: // half-width Katakana
+		return true
+	}
+	return false
+}
+
+// CP437 is the original IBM PC OEM codepage. Its Western European letter
+// repertoire is incomplete: several accented vowels exist only in lower
+// case ("â", "à", "ê", "ë", "è", "ï", "î", "ì", "ô", "ò", "û", "ù", "ÿ", "á",
+// "í", "ó", "ú"), so those fall back to a bare ASCII upper-case letter
+var CP437 Transliterator = codepageTransliterator{repertoire: runeSet(
+	"ÇçüéâäàåêëèïîìÄÅÉæÆôöòûùÿÖÜáíóúñÑ",
+)}
+
+// CP850 is the "Multilingual Latin I" OEM codepage: a near-complete Latin-1
+// letter repertoire, including the upper-case forms CP437 is missing
+var CP850 Transliterator = codepageTransliterator{repertoire: runeSet(
+	"çüéâäàåêëèïîìÄÅÉæÆôöòûùÿÖÜáíóúñÑÂÀÊËÈÏÎÌÔÒÛÙÁÍÓÚãÃðÐõÕþÞýÝ",
+)}
+
+// CP852 is the Central European OEM codepage: Polish, Czech, Slovak and
+// Hungarian letters in place of most of CP850's Western European ones
+var CP852 Transliterator = codepageTransliterator{repertoire: runeSet(
+	"ąĄćĆęĘłŁńŃóÓśŚźŹżŻčČďĎěĚňŇřŘšŠťŤůŮžŽáÁéÉíÍúÚýÝäÄöÖüÜñÑ",
+)}
+
+// CP1252 is the Windows ANSI codepage for Western Europe: essentially the
+// full Latin-1 Supplement letter repertoire
+var CP1252 Transliterator = codepageTransliterator{repertoire: runeSet(
+	"àáâãäåæçèéêëìíîïðñòóôõöøùúûüýþÿÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖØÙÚÛÜÝÞŸ",
+)}
+
+// ShiftJIS is the Japanese codepage
+var ShiftJIS Transliterator = shiftJISTransliterator{}
+
+// TransliteratorsFor returns the Transliterators that make up the given
+// Codepage. An unrecognised or empty Codepage falls back to CodepageCombined
+// rather than silently narrowing to bare ASCII, since a mistyped --codepage
+// value should not cost users wordlist coverage
+func TransliteratorsFor(cp Codepage) []Transliterator {
+	switch cp {
+	case CodepageASCII:
+		return []Transliterator{asciiTransliterator{}}
+	case CodepageCP437:
+		return []Transliterator{CP437}
+	case CodepageCP850:
+		return []Transliterator{CP850}
+	case CodepageCP852:
+		return []Transliterator{CP852}
+	case CodepageCP1252:
+		return []Transliterator{CP1252}
+	case CodepageShiftJIS:
+		return []Transliterator{ShiftJIS}
+	default:
+		return []Transliterator{CP437, CP850, CP852, CP1252, ShiftJIS}
+	}
+}
+
+// runeSet builds a set of the runes in s, for use as a codepage repertoire
+func runeSet(s string) map[rune]struct{} {
+	set := make(map[rune]struct{}, len(s))
+	for _, r := range s {
+		set[r] = struct{}{}
+	}
+	return set
+}
@@ -5,59 +5,57 @@
 // Docs and code: https://github.com/bitquark/shortscan
 // ----------------------------------------------------
 
+// Package shortutil implements Windows 8.3 short filename generation and
+// checksumming as a standalone library, independent of the shortutil CLI
+// (see cmd/shortutil), so it can be embedded in other scanners, fuzzers and
+// test harnesses
 package shortutil
 
 import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"net/url"
-	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 
-	"github.com/alexflint/go-arg"
 	"github.com/bitquark/shortscan/pkg/maths"
-	"github.com/fatih/color"
 	"golang.org/x/text/unicode/norm"
 )
 
-type wordlistRecord struct {
-	checksum    string
-	filename    string
-	extension   string
-	filename83  string
-	extension83 string
+// WordlistRecord is a single checksummed wordlist entry, as produced by ChecksumWords
+type WordlistRecord struct {
+	Checksum    string
+	Filename    string
+	Extension   string
+	Filename83  string
+	Extension83 string
 }
 
-// Command-line arguments
-var args struct {
-	Wordlist *struct {
-		Filename string `arg:"positional,required" help:"wordlist to ingest"`
-		KeepCase bool   `arg:"--keepcase" help:"keep the original case rather than upper-casing words" default:"false"`
-		Uniq     bool   `arg:"--uniq" help:"allow only unique words" default:"true"`
-		Variants bool   `arg:"--variants" help:"generate checksums for case variants of input words (e.g. ping.aspx, Ping.aspx, PING.ASPX)" default:"true"`
-	} `arg:"subcommand:wordlist" help:"add hashes to a wordlist for use with, for example, shortscan"`
-	Checksum *struct {
-		Filename  string       `arg:"positional,required" help:"filename to checksum"`
-		Algorithm checksumAlgo `arg:"-a,--algorithm" help:"checksum algorithm (modern/original/win95/nt/fat32)" default:"modern"`
-		Original  bool         `arg:"-o" help:"use the original (Windows Server 2003 + Windows XP) algorithm" default:"false"` // eskiyle uyum için bırakıldı
-	} `arg:"subcommand:checksum" help:"generate a one-off checksum for the given filename"`
+// Options configures ChecksumWords' output
+type Options struct {
+	KeepCase  bool         // keep the original case rather than upper-casing words
+	Uniq      bool         // allow only unique words
+	Variants  bool         // generate checksums for case variants of input words (e.g. ping.aspx, Ping.aspx, PING.ASPX)
+	Tildes    int          // emit the Nth tilde-collision short name, 1..N, for each word (treated as 1 if less than 1)
+	Hashed    bool         // also emit the NTFS hashed short name (e.g. LO4A12~1), used once six or more files in a directory share a base
+	Algorithm ChecksumAlgo // checksum algorithm used for word/variant checksums
+	Codepage  Codepage     // target OEM/ANSI codepage(s) for non-ASCII words (defaults to CodepageCombined, every codepage at once)
 }
 
-// Checksum algorithms enum
-type checksumAlgo string
+// ChecksumAlgo identifies one of the short filename checksum algorithms
+type ChecksumAlgo string
 
 const (
-	AlgoModern   checksumAlgo = "modern"
-	AlgoOriginal checksumAlgo = "original"
-	AlgoWin95    checksumAlgo = "win95"
-	AlgoNT       checksumAlgo = "nt"
-	AlgoFAT32    checksumAlgo = "fat32"
+	AlgoModern   ChecksumAlgo = "modern"
+	AlgoOriginal ChecksumAlgo = "original"
+	AlgoWin95    ChecksumAlgo = "win95"
+	AlgoNT       ChecksumAlgo = "nt"
+	AlgoFAT32    ChecksumAlgo = "fat32"
 )
 
 // Regular expression to strip URL parameters
@@ -67,9 +65,6 @@ var paramRegex = regexp.MustCompile("[?;#&\r\n]")
 // Special character rules taken from the leaked Windows 2003 source (gen8dot3.c)
 var shortReplacer = strings.NewReplacer(" ", "", ".", "", ":", "_", "+", "_", ",", "_", ";", "_", "=", "_", "[", "_", "]", "_")
 
-// Version
-const version = "0.4"
-
 // Checksum calculates the short filename checksum for the given filename
 // Based on: https://tomgalvin.uk/assets/8dot3-checksum.c
 // Docs: https://tomgalvin.uk/blog/gen/2015/06/09/filenames/
@@ -95,6 +90,14 @@ func Checksum(f string) string {
 // of the checksum algorithm contained in the leaked Windows 2003 Server source
 func ChecksumOriginal(f string) string {
 
+	// The algorithm assumes at least two bytes; pad shorter input with
+	// spaces the way a short 8.3 name is space-padded, so a single
+	// surviving character (e.g. from a punctuation-stripped case variant)
+	// doesn't index out of range
+	if len(f) < 2 {
+		f += strings.Repeat(" ", 2-len(f))
+	}
+
 	var ck uint16
 	ck = (uint16(f[0])<<8 + uint16(f[1])) & 0xffff
 	for i := 2; i < len(f); i += 2 {
@@ -131,13 +134,54 @@ func ChecksumNT(f string) string {
 	return fmt.Sprintf("%04X", sum^0xA5A5)
 }
 
-// ChecksumFAT32: Example FAT32/exFAT checksum (simplified)
-func ChecksumFAT32(f string) string {
+// ChecksumVFATLFN calculates the VFAT long filename checksum, which Windows
+// stores in every long-filename directory entry alongside the 8.3 (short)
+// name it belongs to. name83 must be the 11-byte, space-padded, dot-less
+// 8.3 name (8 bytes base + 3 bytes extension), e.g. "LONGFI~1TXT"
+func ChecksumVFATLFN(name83 string) string {
+
 	var sum uint8
-	for _, c := range f {
-		sum = ((sum >> 1) | (sum << 7)) + uint8(c)
+	for i := 0; i < len(name83); i++ {
+		if sum&1 != 0 {
+			sum = 0x80 + sum>>1 + name83[i]
+		} else {
+			sum = sum>>1 + name83[i]
+		}
 	}
+
 	return fmt.Sprintf("%02X", sum)
+
+}
+
+// ChecksumFAT32 calculates the VFAT long filename checksum for f, first
+// running it through Gen8dot3 to obtain the 8.3 name that Windows would
+// write into the short filename slot, space-padded to 11 bytes
+func ChecksumFAT32(f string) string {
+
+	name, ext := splitFileExt(f)
+	_, f83, e83 := Gen8dot3(name, ext)
+
+	name83 := fmt.Sprintf("%-8s%-3s", f83, e83)
+
+	return ChecksumVFATLFN(name83)
+
+}
+
+// ChecksummerFor returns the checksum function for the given algorithm,
+// falling back to the modern algorithm for an unrecognised one
+func ChecksummerFor(algo ChecksumAlgo) func(string) string {
+	switch algo {
+	case AlgoOriginal:
+		return ChecksumOriginal
+	case AlgoWin95:
+		return ChecksumWin95
+	case AlgoNT:
+		return ChecksumNT
+	case AlgoFAT32:
+		return ChecksumFAT32
+	default:
+		return Checksum
+	}
 }
 
 // Unicode normalization and variant generator
@@ -157,13 +201,18 @@ func ToASCII(s string) string {
 	return string(ascii)
 }
 
-// GenerateVariants generates filename variants (case, special char removal, Turkish char swap, etc)
-func GenerateVariants(s string) []string {
+// GenerateVariants generates filename variants (case, special char removal,
+// Turkish char swap, codepage transliteration, etc). t may be nil, in which
+// case the variant it would have produced is simply omitted
+func GenerateVariants(s string, t Transliterator) []string {
 	variants := map[string]struct{}{}
 	variants[s] = struct{}{}
 	variants[strings.ToLower(s)] = struct{}{}
 	variants[strings.ToUpper(s)] = struct{}{}
 	variants[ToASCII(s)] = struct{}{}
+	if t != nil {
+		variants[t.Transliterate(s)] = struct{}{}
+	}
 	// Turkish char swaps
 	turkish := strings.NewReplacer("ı", "i", "İ", "I", "ö", "o", "Ö", "O", "ü", "u", "Ü", "U", "ş", "s", "Ş", "S", "ğ", "g", "Ğ", "G", "ç", "c", "Ç", "C")
 	variants[turkish.Replace(s)] = struct{}{}
@@ -179,8 +228,13 @@ func GenerateVariants(s string) []string {
 	return out
 }
 
-// Gen8dot3 returns the Windows short filename for a given filename (sans tilde)
-func Gen8dot3(file string, ext string) (bool, string, string) {
+// gen8dot3 is the shared implementation behind Gen8dot3 and its Unicode and
+// tilde-numbered variants. It uppercases and replaces special characters in
+// file and ext (running the result through t when one is given), then, if
+// a short filename was required, truncates the base to leave room for the
+// "~n" collision suffix (e.g. n=1 leaves 6 base characters, n=10 leaves 5,
+// n=100000 leaves 1)
+func gen8dot3(file string, ext string, n int, t Transliterator) (bool, string, string) {
 
 	// Upper case the filename and and replace special characters
 	fu := strings.ToUpper(file)
@@ -190,31 +244,134 @@ func Gen8dot3(file string, ext string) (bool, string, string) {
 	eu := strings.ToUpper(ext)
 	er := shortReplacer.Replace(eu)
 
+	// Transliterate down to the target codepage where requested
+	if t != nil {
+		fr = t.Transliterate(fr)
+		er = t.Transliterate(er)
+	}
+
 	// Determine whether a short filename was required
 	r := len(file) > 8 || len(ext) > 3 || fu != fr || eu != er
+	e83 := er[:maths.Min(len(er), 3)]
+	fb := []rune(fr)
+
+	// The name already fits 8.3, so it is returned whole and no tilde is added
+	if !r {
+		return r, string(fb[:maths.Min(len(fb), 8)]), e83
+	}
+
+	// Leave room for the "~n" suffix, truncating further as n grows
+	suffix := "~" + strconv.Itoa(n)
+	baseLen := 8 - len(suffix)
+	if baseLen < 0 {
+		baseLen = 0
+	}
+
+	return r, string(fb[:maths.Min(len(fb), baseLen)]) + suffix, e83
+
+}
+
+// Gen8dot3 returns the Windows short filename for a given filename. Where a
+// short filename is required it includes the ~1 tilde suffix, Windows'
+// default collision variant; a name that already fits 8.3 has no tilde
+func Gen8dot3(file string, ext string) (bool, string, string) {
+	return gen8dot3(file, ext, 1, nil)
+}
 
-	// Trim and return the names
-	return r, fr[:maths.Min(len(fr), 6)], er[:maths.Min(len(er), 3)]
+// Gen8dot3N is Gen8dot3 for the Nth tilde-collision variant (NAME~1, NAME~2,
+// ... NAME~999999), as Windows assigns once earlier collisions have already
+// claimed the lower numbers
+func Gen8dot3N(file string, ext string, n int) (bool, string, string) {
+	return gen8dot3(file, ext, n, nil)
+}
+
+// Gen8dot3Unicode is Gen8dot3, transliterating the result through t (e.g. one
+// of CP437, CP850, CP852, CP1252, ShiftJIS) so the short filename matches
+// what a non-US Windows host would actually generate. t may be nil, in which
+// case the legacy bare-ASCII behaviour is used
+func Gen8dot3Unicode(file string, ext string, t Transliterator) (bool, string, string) {
+	return gen8dot3(file, ext, 1, orASCII(t))
+}
 
+// Gen8dot3UnicodeN is Gen8dot3N, transliterated through t as Gen8dot3Unicode is
+func Gen8dot3UnicodeN(file string, ext string, n int, t Transliterator) (bool, string, string) {
+	return gen8dot3(file, ext, n, orASCII(t))
+}
+
+// orASCII substitutes the legacy ASCII transliterator for a nil Transliterator,
+// preserving Gen8dot3Unicode's historic behaviour when no codepage is given
+func orASCII(t Transliterator) Transliterator {
+	if t == nil {
+		return asciiTransliterator{}
+	}
+	return t
 }
 
-// Gen8dot3Unicode returns the Windows short filename for a given filename (sans tilde), Unicode aware, with variants
-func Gen8dot3Unicode(file string, ext string) (bool, string, string) {
+// Gen8dot3Hash returns the hashed short filename that Windows falls back to
+// once six or more files in a directory share the same truncated base: the
+// first two characters of the base, a 4 hex-digit checksum of the long
+// filename, then "~1" (e.g. "LO4A12~1"). t is transliterated through as
+// gen8dot3 does, so the retained base characters match the target codepage;
+// t may be nil, in which case the legacy bare-ASCII behaviour is used
+func Gen8dot3Hash(file string, ext string, t Transliterator) (bool, string, string) {
+
 	fu := strings.ToUpper(file)
 	fr := shortReplacer.Replace(fu)
-	fr = ToASCII(fr)
 	eu := strings.ToUpper(ext)
 	er := shortReplacer.Replace(eu)
-	er = ToASCII(er)
+
+	t = orASCII(t)
+	fr = t.Transliterate(fr)
+	er = t.Transliterate(er)
+
 	r := len(file) > 8 || len(ext) > 3 || fu != fr || eu != er
-	return r, fr[:maths.Min(len(fr), 6)], er[:maths.Min(len(er), 3)]
+	e83 := er[:maths.Min(len(er), 3)]
+
+	if !r {
+		return r, fr[:maths.Min(len(fr), 6)], e83
+	}
+
+	long := file
+	if ext != "" {
+		long += "." + ext
+	}
+
+	fb := []rune(fr)
+	return r, string(fb[:maths.Min(len(fb), 2)]) + Checksum(long) + "~1", e83
+
+}
+
+// splitFileExt splits a word into its filename and extension, the same way
+// Windows splits a long filename before generating a short one: on the last
+// dot, unless that dot is the first character of the word
+func splitFileExt(w string) (string, string) {
+	if p := strings.LastIndex(w, "."); p > 0 && w[0] != '.' {
+		return w[:p], w[p+1:]
+	}
+	return w, ""
 }
 
-// ChecksumWords turns a list of words into a word/checksum map
-func ChecksumWords(fh io.Reader, paramRegex *regexp.Regexp) []wordlistRecord {
+// ChecksumWords reads a wordlist from fh, one word per line, and returns a
+// checksummed WordlistRecord for every word Windows would generate a short
+// filename for, shaped by opts
+func ChecksumWords(fh io.Reader, opts Options) []WordlistRecord {
+
+	checksummer := ChecksummerFor(opts.Algorithm)
+
+	tildes := opts.Tildes
+	if tildes < 1 {
+		tildes = 1
+	}
+
+	cp := opts.Codepage
+	if cp == "" {
+		cp = CodepageCombined
+	}
+	transliterators := TransliteratorsFor(cp)
 
 	// Loop through each word in the wordlist
-	var wc []wordlistRecord
+	var wc []WordlistRecord
+	seen := make(map[string]struct{})
 	s := bufio.NewScanner(fh)
 	for s.Scan() {
 
@@ -230,112 +387,90 @@ func ChecksumWords(fh io.Reader, paramRegex *regexp.Regexp) []wordlistRecord {
 		w = strings.ReplaceAll(w, "\t", "")
 
 		// Split the file and extension
-		var f, e string
-		if p := strings.LastIndex(w, "."); p > 0 && w[0] != '.' {
-			f, e = w[:p], w[p+1:]
-		} else {
-			f, e = w, ""
+		f, e := splitFileExt(w)
+
+		// Skip the word unless at least one configured codepage would cause
+		// Windows to generate a distinct short filename for it (a codepage
+		// that can represent the word's accented characters natively may
+		// never need to, even when the bare-ASCII fallback would)
+		skip := true
+		for _, t := range transliterators {
+			if r, _, _ := Gen8dot3Unicode(f, e, t); r {
+				skip = false
+				break
+			}
 		}
-
-		// Generate an 8.3 filename for the word
-		r, f83, e83 := Gen8dot3Unicode(f, e)
-
-		// Skip the word if Windows wouldn't generate a short filename
-		if !r {
+		if skip {
 			continue
 		}
 
-		// Generate checksums for case variants
-		vs := make(map[string]struct{})
-		if args.Wordlist.Variants {
-			for _, v := range GenerateVariants(w) {
-				vs[Checksum(v)] = struct{}{}
-			}
-		}
+		// Generate checksums for case variants, merging in every configured
+		// codepage's transliteration (de-duplicated by checksum, since vs is a set)
 		var c string
-		for v := range vs {
-			c += v
+		if opts.Variants {
+			vs := make(map[string]struct{})
+			for _, t := range transliterators {
+				for _, v := range GenerateVariants(w, t) {
+					vs[checksummer(v)] = struct{}{}
+				}
+			}
+			for v := range vs {
+				c += v
+			}
 		}
 
-		// Add the wordlist entry to the list
-		wc = append(wc, wordlistRecord{c, f, e, f83, e83})
-
-	}
-
-	// Return the word/checksum map
-	return wc
-
-}
-
-// Run is the main entry point for using utuilities from the command line
-func Run() {
-
-	// Parse command-line arguments
-	p := arg.MustParse(&args)
-	if p.Subcommand() == nil {
-		fmt.Println(color.New(color.FgBlue, color.Bold).Sprint("Shortutil v"+version), "·", color.New(color.FgWhite, color.Bold).Sprint("a short filename utility by bitquark"))
-		p.WriteHelp(os.Stderr)
-		os.Exit(1)
-	}
-
-	// Set the data source
-	var err error
-	var fh io.Reader
-
-	switch {
-
-	// Process a wordlist
-	case args.Wordlist != nil:
-
-		// Open the wordlist
-		fh, err = os.Open(args.Wordlist.Filename)
-		if err != nil {
-			log.Fatalf("Error: %s\n", err)
+		// Upper case the wordlist entry unless the original case was requested
+		of, oe := f, e
+		if !opts.KeepCase {
+			of, oe = strings.ToUpper(f), strings.ToUpper(e)
 		}
 
-		// Ouput the header and start checksumming
-		fmt.Println("#SHORTSCAN#")
-		words := make(map[string]struct{})
-		for _, w := range ChecksumWords(fh, paramRegex) {
-
-			// Upper case the wordlist entry
-			var f, e string
-			if args.Wordlist.KeepCase {
-				f, e = w.filename, w.extension
-			} else {
-				f, e = strings.ToUpper(w.filename), strings.ToUpper(w.extension)
+		// add appends a wordlist entry for the given 8.3 name, uniqued against
+		// every other short/long filename pair seen so far when requested
+		add := func(f83, e83 string) {
+			if opts.Uniq {
+				key := of + "." + oe + "\t" + f83 + "." + e83
+				if _, dup := seen[key]; dup {
+					return
+				}
+				seen[key] = struct{}{}
 			}
+			wc = append(wc, WordlistRecord{c, of, oe, f83, e83})
+		}
 
-			// Uniq the entry
-			if args.Wordlist.Uniq {
-				fe := f + "." + e
-				if _, a := words[fe]; a {
+		// Add an entry for each requested tilde-collision variant (NAME~1,
+		// NAME~2, ...) of each configured codepage, since an earlier-colliding
+		// file may already have claimed the lower numbers. Different codepages
+		// often transliterate a word identically, so identical short names are
+		// only added once per word regardless of Uniq
+		pairs := make(map[string]struct{})
+		for _, t := range transliterators {
+			for n := 1; n <= tildes; n++ {
+				_, f83, e83 := Gen8dot3UnicodeN(f, e, n, t)
+				if _, dup := pairs[f83+"."+e83]; dup {
 					continue
 				}
-				words[fe] = struct{}{}
+				pairs[f83+"."+e83] = struct{}{}
+				add(f83, e83)
 			}
-
-			// Output the entry
-			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", w.checksum, w.filename83, w.extension83, f, e)
-
 		}
 
-	// Generate a one-off checksum
-	case args.Checksum != nil:
-		var c string
-		switch args.Checksum.Algorithm {
-		case AlgoOriginal:
-			c = ChecksumOriginal(args.Checksum.Filename)
-		case AlgoWin95:
-			c = ChecksumWin95(args.Checksum.Filename)
-		case AlgoNT:
-			c = ChecksumNT(args.Checksum.Filename)
-		case AlgoFAT32:
-			c = ChecksumFAT32(args.Checksum.Filename)
-		default:
-			c = Checksum(args.Checksum.Filename)
+		// Optionally also add the NTFS hashed short name variant, once per
+		// configured codepage, the same way the tilde loop above does
+		if opts.Hashed {
+			for _, t := range transliterators {
+				_, f83, e83 := Gen8dot3Hash(f, e, t)
+				if _, dup := pairs[f83+"."+e83]; dup {
+					continue
+				}
+				pairs[f83+"."+e83] = struct{}{}
+				add(f83, e83)
+			}
 		}
-		fmt.Println(c)
+
 	}
 
+	// Return the checksummed wordlist
+	return wc
+
 }
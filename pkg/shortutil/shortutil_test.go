@@ -0,0 +1,205 @@
+package shortutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksumVFATLFN(t *testing.T) {
+
+	cases := []struct {
+		name83 string
+		want   string
+	}{
+		{"FRED    TXT", "9B"},
+		{"LONGFI~1TXT", "D4"},
+		{"WELCOM~1HTM", "F5"},
+		{"TEST       ", "32"},
+	}
+
+	for _, c := range cases {
+		if got := ChecksumVFATLFN(c.name83); got != c.want {
+			t.Errorf("ChecksumVFATLFN(%q) = %s, want %s", c.name83, got, c.want)
+		}
+	}
+
+}
+
+func TestChecksumFAT32(t *testing.T) {
+
+	cases := []struct {
+		filename string
+		want     string
+	}{
+		{"FRED.TXT", "9B"},
+		{"TEST", "32"},
+		{"LongFileName.txt", "D4"},
+	}
+
+	for _, c := range cases {
+		if got := ChecksumFAT32(c.filename); got != c.want {
+			t.Errorf("ChecksumFAT32(%q) = %s, want %s", c.filename, got, c.want)
+		}
+	}
+
+}
+
+func TestGen8dot3N(t *testing.T) {
+
+	cases := []struct {
+		file, ext string
+		n         int
+		wantR     bool
+		wantBase  string
+	}{
+		{"LongFileName", "txt", 1, true, "LONGFI~1"},
+		{"LongFileName", "txt", 2, true, "LONGFI~2"},
+		{"LongFileName", "txt", 10, true, "LONGF~10"},
+		{"LongFileName", "txt", 100000, true, "L~100000"},
+		{"Fred", "txt", 1, false, "FRED"},
+	}
+
+	for _, c := range cases {
+		r, base, _ := Gen8dot3N(c.file, c.ext, c.n)
+		if r != c.wantR || base != c.wantBase {
+			t.Errorf("Gen8dot3N(%q, %q, %d) = %v, %q, want %v, %q", c.file, c.ext, c.n, r, base, c.wantR, c.wantBase)
+		}
+	}
+
+}
+
+func TestGen8dot3Hash(t *testing.T) {
+
+	_, base, ext := Gen8dot3Hash("LongFileName", "txt", nil)
+	if want := "LO" + Checksum("LongFileName.txt") + "~1"; base != want {
+		t.Errorf("Gen8dot3Hash base = %q, want %q", base, want)
+	}
+	if ext != "TXT" {
+		t.Errorf("Gen8dot3Hash ext = %q, want TXT", ext)
+	}
+
+	// The retained prefix characters must reflect the target codepage, the
+	// same way the tilde-collision variants do (CP437 has the upper-case
+	// "Ü" that bare ASCII stripping does not)
+	_, cp437Base, _ := Gen8dot3Hash("Überlangname", "txt", CP437)
+	_, asciiBase, _ := Gen8dot3Hash("Überlangname", "txt", asciiTransliterator{})
+	if cp437Base == asciiBase {
+		t.Errorf("Gen8dot3Hash(%q) with CP437 and ASCII transliterators produced the same base %q, want different", "Überlangname", cp437Base)
+	}
+
+}
+
+func TestChecksummerFor(t *testing.T) {
+
+	cases := []struct {
+		algo ChecksumAlgo
+		want func(string) string
+	}{
+		{AlgoModern, Checksum},
+		{AlgoOriginal, ChecksumOriginal},
+		{AlgoWin95, ChecksumWin95},
+		{AlgoNT, ChecksumNT},
+		{AlgoFAT32, ChecksumFAT32},
+		{"bogus", Checksum},
+	}
+
+	for _, c := range cases {
+		got := ChecksummerFor(c.algo)("test.txt")
+		want := c.want("test.txt")
+		if got != want {
+			t.Errorf("ChecksummerFor(%q)(\"test.txt\") = %s, want %s", c.algo, got, want)
+		}
+	}
+
+}
+
+func TestChecksumOriginalShortInput(t *testing.T) {
+
+	// Must not panic on input shorter than two bytes, as a case variant
+	// (e.g. a punctuation-heavy word stripped down by nonAlphanum) can produce
+	ChecksumOriginal("")
+	ChecksumOriginal("a")
+
+}
+
+func TestCodepageTransliterate(t *testing.T) {
+
+	cases := []struct {
+		t    Transliterator
+		in   string
+		want string
+	}{
+		// CP437 has no upper-case "Â", so it falls back to bare "A"
+		{CP437, "âge", "AGE"},
+		// CP437 does have the é/É pair
+		{CP437, "café", "CAFÉ"},
+		// CP850 and CP1252 have the â/Â pair that CP437 is missing
+		{CP850, "âge", "ÂGE"},
+		{CP1252, "âge", "ÂGE"},
+		// Shift-JIS has no accented Latin letters, so "é" falls back to bare "E"
+		{ShiftJIS, "café", "CAFE"},
+	}
+
+	for _, c := range cases {
+		if got := c.t.Transliterate(c.in); got != c.want {
+			t.Errorf("Transliterate(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+
+}
+
+func TestTransliteratorsForUnrecognised(t *testing.T) {
+
+	// A mistyped or unrecognised --codepage value must not silently narrow
+	// coverage down to bare ASCII: it should fall back to the same,
+	// documented combined set as an empty/default Codepage
+	want := TransliteratorsFor(CodepageCombined)
+	got := TransliteratorsFor(Codepage("cp1251"))
+	if len(got) != len(want) {
+		t.Fatalf("TransliteratorsFor(%q) returned %d transliterators, want %d (combined)", "cp1251", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Transliterate("âge") != want[i].Transliterate("âge") {
+			t.Errorf("TransliteratorsFor(%q)[%d] behaves differently from the combined set", "cp1251", i)
+		}
+	}
+
+}
+
+func TestChecksumWordsCodepageAwareSkip(t *testing.T) {
+
+	// CP437 can represent "café" (upper-cased "CAFÉ") natively within 8.3,
+	// so a CP437-only wordlist shouldn't generate a short name for it, even
+	// though the bare-ASCII fallback would
+	wc := ChecksumWords(strings.NewReader("café.txt\n"), Options{Codepage: CodepageCP437})
+	if len(wc) != 0 {
+		t.Errorf("ChecksumWords(%q, CP437) returned %d records, want 0", "café.txt", len(wc))
+	}
+
+}
+
+func TestChecksumWords(t *testing.T) {
+
+	wc := ChecksumWords(strings.NewReader("LongFileName.txt\n"), Options{Tildes: 3})
+	if len(wc) != 3 {
+		t.Fatalf("ChecksumWords returned %d records, want 3", len(wc))
+	}
+	for i, w := range wc {
+		wantBase := []string{"LONGFI~1", "LONGFI~2", "LONGFI~3"}[i]
+		if w.Filename83 != wantBase {
+			t.Errorf("record %d Filename83 = %q, want %q", i, w.Filename83, wantBase)
+		}
+		if w.Filename != "LONGFILENAME" || w.Extension != "TXT" {
+			t.Errorf("record %d Filename/Extension = %q/%q, want LONGFILENAME/TXT", i, w.Filename, w.Extension)
+		}
+	}
+
+}
+
+func TestChecksumWordsOriginalAlgorithmPunctuation(t *testing.T) {
+
+	// A punctuation-heavy word can be stripped down to a single character
+	// by one of GenerateVariants' case variants; must not panic
+	ChecksumWords(strings.NewReader("~~~~~~~~a\n"), Options{Variants: true, Algorithm: AlgoOriginal})
+
+}